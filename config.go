@@ -0,0 +1,149 @@
+package main
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// uploadConfig holds the settings that decide which Uploader implementation
+// backs the program and how it behaves. `backend` picks the destination
+// (http, s3, sftp); each backend has its own config block below it.
+type uploadConfig struct {
+	backend string
+	http    httpConfig
+	s3      s3Config
+	sftp    sftpConfig
+}
+
+// httpConfig covers the original HTTP destination, which itself supports
+// two upload modes: a single-shot multipart POST or the resumable tus
+// protocol.
+type httpConfig struct {
+	mode string
+	tus  tusConfig
+}
+
+// tusConfig covers settings specific to the tus upload mode. Retry/backoff
+// policy for its chunk PATCH/HEAD requests comes from the shared
+// retryConfig (see loadRetryConfig) instead of a second config block, so
+// there's one knob for retry behavior across the whole program.
+type tusConfig struct {
+	chunkSizeBytes int64
+}
+
+func loadUploadConfig() uploadConfig {
+	viper.SetDefault("backend", "http")
+	viper.SetDefault("http.mode", "multipart")
+	viper.SetDefault("tus.chunkSizeBytes", 4*1024*1024)
+
+	return uploadConfig{
+		backend: viper.GetString("backend"),
+		http: httpConfig{
+			mode: viper.GetString("http.mode"),
+			tus: tusConfig{
+				chunkSizeBytes: viper.GetInt64("tus.chunkSizeBytes"),
+			},
+		},
+		s3:   loadS3Config(),
+		sftp: loadSFTPConfig(),
+	}
+}
+
+func loadS3Config() s3Config {
+	return s3Config{
+		region:          viper.GetString("s3.region"),
+		bucket:          viper.GetString("s3.bucket"),
+		prefix:          viper.GetString("s3.prefix"),
+		endpoint:        viper.GetString("s3.endpoint"),
+		accessKeyID:     viper.GetString("s3.accessKeyId"),
+		secretAccessKey: viper.GetString("s3.secretAccessKey"),
+	}
+}
+
+func loadSFTPConfig() sftpConfig {
+	viper.SetDefault("sftp.port", 22)
+
+	return sftpConfig{
+		host:           viper.GetString("sftp.host"),
+		port:           viper.GetInt("sftp.port"),
+		user:           viper.GetString("sftp.user"),
+		password:       viper.GetString("sftp.password"),
+		privateKeyPath: viper.GetString("sftp.privateKeyPath"),
+		knownHostsPath: viper.GetString("sftp.knownHostsPath"),
+		remoteDir:      viper.GetString("sftp.remoteDir"),
+	}
+}
+
+func loadMetricsAddr() string {
+	return viper.GetString("metricsAddr")
+}
+
+func loadWorkerCount() int {
+	viper.SetDefault("workers", 4)
+	return viper.GetInt("workers")
+}
+
+func loadRetryConfig() retryConfig {
+	viper.SetDefault("retry.maxAttempts", 5)
+	viper.SetDefault("retry.baseDelayMs", 500)
+	viper.SetDefault("retry.maxDelayMs", 30000)
+
+	return retryConfig{
+		maxAttempts: viper.GetInt("retry.maxAttempts"),
+		baseDelay:   time.Duration(viper.GetInt("retry.baseDelayMs")) * time.Millisecond,
+		maxDelay:    time.Duration(viper.GetInt("retry.maxDelayMs")) * time.Millisecond,
+	}
+}
+
+// guardConfig holds the pre-upload checks lockAndProcessFile applies before
+// handing a file to the uploader. A zero value disables the corresponding
+// guard.
+type guardConfig struct {
+	maxFileBytes int64
+	minAge       time.Duration
+}
+
+func loadGuardConfig() guardConfig {
+	return guardConfig{
+		maxFileBytes: viper.GetInt64("maxFileBytes"),
+		minAge:       time.Duration(viper.GetInt("minAgeSeconds")) * time.Second,
+	}
+}
+
+// scanConfig controls the fsnotify-driven scan pipeline.
+type scanConfig struct {
+	scanInterval time.Duration
+	quietPeriod  time.Duration
+}
+
+func loadScanConfig() scanConfig {
+	viper.SetDefault("scanIntervalSeconds", 30)
+	viper.SetDefault("quietPeriodMs", 500)
+
+	return scanConfig{
+		scanInterval: time.Duration(viper.GetInt("scanIntervalSeconds")) * time.Second,
+		quietPeriod:  time.Duration(viper.GetInt("quietPeriodMs")) * time.Millisecond,
+	}
+}
+
+// newUploaderFromConfig selects the Uploader implementation named by
+// `backend` in conf.yaml. Unrecognized or empty values fall back to the
+// original HTTP behavior. retry is the shared retryConfig, passed through
+// to backends (currently just tus) that need their own request-level retry
+// loop in addition to processFileWithRetry's outer one.
+func newUploaderFromConfig(cfg uploadConfig, uploadURL string, retry retryConfig) (Uploader, error) {
+	switch cfg.backend {
+	case "s3":
+		return newS3Uploader(cfg.s3)
+	case "sftp":
+		return newSFTPUploader(cfg.sftp), nil
+	default:
+		switch cfg.http.mode {
+		case "tus":
+			return newTusUploader(uploadURL, cfg.http.tus.chunkSizeBytes, retry), nil
+		default:
+			return newMultipartUploader(uploadURL), nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// healthWindowSize is how many recent upload outcomes healthTracker keeps
+// around to decide readiness.
+const healthWindowSize = 20
+
+// healthTracker remembers the outcome of the last few uploads so /readyz
+// can pull the pod out of rotation when the upstream is definitely broken,
+// rather than on a single blip.
+type healthTracker struct {
+	mu      sync.Mutex
+	results []bool
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{}
+}
+
+func (h *healthTracker) record(success bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.results = append(h.results, success)
+	if len(h.results) > healthWindowSize {
+		h.results = h.results[len(h.results)-healthWindowSize:]
+	}
+}
+
+// healthy reports false only once the window is full of nothing but
+// failures - a handful of failed uploads shouldn't flap readiness.
+func (h *healthTracker) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.results) < healthWindowSize {
+		return true
+	}
+	for _, ok := range h.results {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startMetricsServer serves /metrics, /healthz and /readyz on addr. It is a
+// no-op if addr is empty, so the endpoint is opt-in via conf.yaml.
+func (p *program) startMetricsServer(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.checkReady(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "not ready: %v", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	go func() {
+		slog.Info("Metrics server listening", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
+
+func (p *program) checkReady() error {
+	for _, dir := range []string{p.sourceDir, p.completedDir, p.failedDir} {
+		if err := checkWritable(dir); err != nil {
+			return fmt.Errorf("%v not writable: %v", dir, err)
+		}
+	}
+
+	if !p.health.healthy() {
+		return fmt.Errorf("last %v uploads all failed", healthWindowSize)
+	}
+	return nil
+}
+
+// writableProbeName is also excluded by scanner.go, since checkWritable
+// creates it directly inside sourceDir.
+const writableProbeName = ".writable-probe"
+
+func checkWritable(dir string) error {
+	probe := filepath.Join(dir, writableProbeName)
+	f, err := os.Create(probe)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(probe)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+
+	"github.com/lmittmann/tint"
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type correlationIDKey struct{}
+
+// withCorrelationID stamps ctx with id so every log line for a file's
+// journey from the moment a worker picks it up - lockAndProcessFile,
+// processFile, retries, and the final move - can be traced back to the same
+// upload.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+func correlationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+func newCorrelationID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// loggerFor returns the process logger tagged with ctx's correlation ID, if
+// any.
+func loggerFor(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := correlationIDFrom(ctx); id != "" {
+		return logger.With("correlationId", id)
+	}
+	return logger
+}
+
+type logConfig struct {
+	format string
+	level  slog.Level
+}
+
+func loadLogConfig() logConfig {
+	viper.SetDefault("log.format", "console")
+	viper.SetDefault("log.level", "info")
+
+	return logConfig{
+		format: viper.GetString("log.format"),
+		level:  parseLogLevel(viper.GetString("log.level")),
+	}
+}
+
+func parseLogLevel(s string) slog.Level {
+	switch s {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// newLogger builds the process-wide logger: JSON routed through lumberjack
+// for rotation in production, colored console output in dev, selected by
+// `log.format` in conf.yaml.
+func newLogger(cfg logConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.level}
+
+	if cfg.format == "json" {
+		sink := &lumberjack.Logger{
+			Filename:   "./file-uploader.log",
+			MaxSize:    10,
+			MaxBackups: 3,
+		}
+		return slog.New(slog.NewJSONHandler(sink, opts))
+	}
+
+	return slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: cfg.level}))
+}
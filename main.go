@@ -1,55 +1,80 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"mime/multipart"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/judwhite/go-svc/svc"
-	"github.com/juju/fslock"
 	"github.com/spf13/viper"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type program struct {
 	shutdown chan bool // Signals that shutdown is starting
 	done     chan bool // Signals when shutdown is completed
 
+	ctx    context.Context // Canceled when shutdown starts, so in-flight uploads and retry backoffs abort promptly
+	cancel context.CancelFunc
+
 	sourceDir    string
 	completedDir string
 	failedDir    string
 
 	uploadURL string
+	uploader  Uploader
+
+	workers int
+	retry   retryConfig
+	guards  guardConfig
+	health  *healthTracker
 }
 
+// processFiles starts p.workers goroutines pulling filenames off
+// scanChannel. An inFlightSet dedupes filenames the scanner re-emits (e.g.
+// from a reconciliation sweep) while a worker is still processing them.
 func (p *program) processFiles(scanChannel <-chan string) {
 	p.done = make(chan bool)
+	inFlight := newInFlightSet()
 
-	go func() {
-		defer close(p.done)
+	var wg sync.WaitGroup
+	wg.Add(p.workers)
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			defer wg.Done()
 
-		for {
-			filename, ok := <-scanChannel
-			if !ok {
-				return
-			}
-			if err := p.lockAndProcessFile(filename); err != nil {
-				log.Println(err)
+			for filename := range scanChannel {
+				queueDepth.Dec()
+
+				if !inFlight.tryAdd(filename) {
+					continue
+				}
+
+				ctx := withCorrelationID(p.ctx, newCorrelationID())
+
+				inflightUploads.Inc()
+				if err := p.lockAndProcessFile(ctx, filename); err != nil {
+					loggerFor(ctx).Error("Failed to process file", "path", filename, "error", err)
+				}
+				inflightUploads.Dec()
+
+				inFlight.remove(filename)
 			}
-		}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(p.done)
 	}()
 }
 
-func (p *program) lockAndProcessFile(path string) error {
-	log.Printf("Attempting to lock file %s", path)
-
+func (p *program) lockAndProcessFile(ctx context.Context, path string) error {
 	fi, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -62,124 +87,74 @@ func (p *program) lockAndProcessFile(path string) error {
 		return nil
 	}
 
-	lock := fslock.New(path)
-	i := 0
-	for {
-		if err := lock.TryLock(); err != nil {
-			if i > 5 {
-				return err
-			}
-			i++
-		} else {
-			break
-		}
-		time.Sleep(500 * time.Millisecond)
+	if p.guards.minAge > 0 && time.Since(fi.ModTime()) < p.guards.minAge {
+		// Too fresh - skip it this cycle. The scanner's reconciliation sweep
+		// will re-emit it on its next pass if it's still here.
+		return nil
 	}
-	lock.Unlock()
-
-	return p.processFile(path)
-}
 
-func (p *program) processFile(path string) error {
-	log.Printf("Processing file: %v\n", path)
-	file, err := os.Open(path)
-	if err != nil {
-		return err
+	if p.guards.maxFileBytes > 0 && fi.Size() > p.guards.maxFileBytes {
+		return p.rejectOversizedFile(ctx, path, fi.Size())
 	}
 
-	r, w := io.Pipe()
-	mpw := multipart.NewWriter(w)
-	go func() {
-		defer file.Close()
-		defer w.Close()
-
-		part, err := mpw.CreateFormFile("file", filepath.Base(path))
-		if err != nil {
-			log.Printf("Failed to create body: %v", err)
-			return
-		}
+	return p.processFileWithRetry(ctx, path)
+}
 
-		size, err := io.Copy(part, file)
-		if err != nil {
-			log.Printf("Failed to copy file: %v", err)
-			return
-		}
-		log.Printf("Uploaded %v bytes for file %v", size, path)
+// rejectOversizedFile moves a file straight to failedDir without making an
+// upload attempt, since we already know from its size on disk that it would
+// be rejected by the destination anyway.
+func (p *program) rejectOversizedFile(ctx context.Context, path string, size int64) error {
+	err := fmt.Errorf("size %v exceeds maxFileBytes %v", size, p.guards.maxFileBytes)
+	return p.moveToFailed(ctx, path, "too_large", err)
+}
 
-		if err = mpw.Close(); err != nil {
-			log.Printf("Failed to close Request: %v", err)
-		}
-	}()
+// processFile makes a single upload attempt; processFileWithRetry is
+// responsible for retries and for moving the file to completedDir/failedDir.
+func (p *program) processFile(ctx context.Context, path string) (UploadResult, error) {
+	loggerFor(ctx).Info("Processing file", "path", path)
 
-	// Post to Server, goroutine above will pipe file contents to the request
-	resp, err := http.Post(p.uploadURL, mpw.FormDataContentType(), r)
+	fi, err := os.Stat(path)
 	if err != nil {
-		return err
+		return UploadResult{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode > 300 {
-		failedPath := filepath.Join(p.failedDir, filepath.Base(path))
-		if err := os.Rename(path, failedPath); err != nil {
-			log.Printf("Failed to move failed file: %v. %v", path, err)
-			// continue
-		}
+	meta := UploadMeta{Filename: filepath.Base(path), Size: fi.Size()}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("Failed Upload. Status Code: %v. Could not parse body: %v", resp.StatusCode, err)
-		}
-		return fmt.Errorf("Failed Upload. Status Code: %v, Body: %v", resp.StatusCode, string(body))
-	}
+	start := time.Now()
+	result, err := p.uploader.Upload(ctx, path, meta)
+	uploadDurationSeconds.Observe(time.Since(start).Seconds())
+	uploadBytes.Observe(float64(meta.Size))
 
-	// Success!
-	newPath := filepath.Join(p.completedDir, filepath.Base(path))
-	if err := os.Rename(path, newPath); err != nil {
-		return fmt.Errorf("Failed to move completed file: %v", err)
-	}
-	return nil
+	return result, err
 }
 
-func (p *program) timedScan() <-chan string {
-	fileChannel := make(chan string)
-
-	ticker := time.NewTicker(1 * time.Second)
-	go func() {
-		defer close(fileChannel)
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := p.scanDirectory(fileChannel); err != nil {
-					log.Printf("Failed to read dir: %v", err)
-				}
-			case <-p.shutdown:
-				return
-			}
-		}
-	}()
+// inFlightSet tracks filenames currently being processed so the same file
+// isn't handed to two workers at once. It's naturally bounded by p.workers,
+// since at most one entry exists per active worker.
+type inFlightSet struct {
+	mu  sync.Mutex
+	set map[string]bool
+}
 
-	return fileChannel
+func newInFlightSet() *inFlightSet {
+	return &inFlightSet{set: make(map[string]bool)}
 }
 
-func (p *program) scanDirectory(channel chan<- string) error {
-	dir, err := os.Open(p.sourceDir)
-	if err != nil {
-		return err
-	}
+func (s *inFlightSet) tryAdd(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	files, err := dir.Readdir(-1)
-	if err != nil {
-		return err
+	if s.set[name] {
+		return false
 	}
+	s.set[name] = true
+	return true
+}
 
-	for _, fi := range files {
-		if !fi.IsDir() {
-			filename := filepath.Join(p.sourceDir, fi.Name())
-			channel <- filename
-		}
-	}
-	return nil
+func (s *inFlightSet) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.set, name)
 }
 
 func createURL() string {
@@ -206,12 +181,25 @@ func (p *program) Init(env svc.Environment) error {
 	p.failedDir = viper.GetString("failedDir")
 	p.uploadURL = createURL()
 
+	p.retry = loadRetryConfig()
+
+	uploader, err := newUploaderFromConfig(loadUploadConfig(), p.uploadURL, p.retry)
+	if err != nil {
+		log.Panicf("Could not configure uploader: %v", err)
+	}
+	p.uploader = uploader
+
+	p.workers = loadWorkerCount()
+	p.guards = loadGuardConfig()
+	p.health = newHealthTracker()
+
+	slog.SetDefault(newLogger(loadLogConfig()))
+
 	return nil
 }
 
 func (p *program) Start() error {
-	log.Printf("Starting file-uploader.  SourceDir=%v, CompletedDir=%v, UploadUrl=%v",
-		p.sourceDir, p.completedDir, p.uploadURL)
+	slog.Info("Starting file-uploader", "sourceDir", p.sourceDir, "completedDir", p.completedDir, "uploadUrl", p.uploadURL)
 
 	go p.run()
 
@@ -231,8 +219,11 @@ func (p *program) run() {
 		log.Panicf("Couldn't create failed dir")
 	}
 
+	p.startMetricsServer(loadMetricsAddr())
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
 	p.shutdown = make(chan bool)
-	scanChannel := p.timedScan()
+	scanChannel := p.watchAndScan(loadScanConfig())
 
 	p.processFiles(scanChannel)
 
@@ -241,22 +232,17 @@ func (p *program) run() {
 }
 
 func (p *program) Stop() error {
-	log.Println("Received shutdown signal.")
+	slog.Info("Received shutdown signal.")
 
 	close(p.shutdown)
+	p.cancel()
 	<-p.done
 
-	log.Println("Shutdown complete")
+	slog.Info("Shutdown complete")
 	return nil
 }
 
 func main() {
-	log.SetOutput(&lumberjack.Logger{
-		Filename:   "./file-uploader.log",
-		MaxSize:    10,
-		MaxBackups: 3,
-	})
-
 	prg := &program{}
 	if err := svc.Run(prg); err != nil {
 		log.Panicf("Unable to run the service: %v", err)
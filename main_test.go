@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInFlightSetTryAdd(t *testing.T) {
+	s := newInFlightSet()
+
+	if !s.tryAdd("a") {
+		t.Fatal("tryAdd(\"a\") = false on first add, want true")
+	}
+	if s.tryAdd("a") {
+		t.Fatal("tryAdd(\"a\") = true while already in flight, want false")
+	}
+
+	s.remove("a")
+	if !s.tryAdd("a") {
+		t.Fatal("tryAdd(\"a\") = false after remove, want true")
+	}
+}
+
+func TestInFlightSetConcurrentTryAdd(t *testing.T) {
+	s := newInFlightSet()
+
+	var wg sync.WaitGroup
+	successes := make(chan bool, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			successes <- s.tryAdd("same-file")
+		}()
+	}
+	wg.Wait()
+	close(successes)
+
+	wins := 0
+	for ok := range successes {
+		if ok {
+			wins++
+		}
+	}
+	if wins != 1 {
+		t.Fatalf("tryAdd succeeded %v times for the same name under concurrent callers, want exactly 1", wins)
+	}
+}
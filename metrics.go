@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	filesUploadedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "files_uploaded_total",
+		Help: "Total number of files successfully uploaded.",
+	})
+
+	filesFailedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "files_failed_total",
+		Help: "Total number of files that were moved to failedDir, by reason.",
+	}, []string{"reason"})
+
+	retriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retries_total",
+		Help: "Total number of upload retries attempted.",
+	})
+
+	uploadDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "upload_duration_seconds",
+		Help:    "Duration of individual upload attempts.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	uploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "upload_bytes",
+		Help:    "Size in bytes of the file sent in each upload attempt.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "queue_depth",
+		Help: "Number of files the scanner has emitted that no worker has started yet.",
+	})
+
+	inflightUploads = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "inflight_uploads",
+		Help: "Number of uploads currently in progress.",
+	})
+)
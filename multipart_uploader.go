@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+)
+
+// multipartUploader is the original upload mode: a single-shot HTTP POST
+// with the file streamed in as multipart form data.
+type multipartUploader struct {
+	uploadURL string
+}
+
+func newMultipartUploader(uploadURL string) *multipartUploader {
+	return &multipartUploader{uploadURL: uploadURL}
+}
+
+func (u *multipartUploader) Upload(ctx context.Context, path string, meta UploadMeta) (UploadResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	logger := loggerFor(ctx)
+
+	r, w := io.Pipe()
+	mpw := multipart.NewWriter(w)
+	sha := sha256.New()
+	md := md5.New()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.uploadURL, r)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	req.Header.Set("Content-Type", mpw.FormDataContentType())
+
+	// The digest and Content-MD5 values aren't known until every byte has
+	// been streamed, so they're sent as trailers rather than headers. The
+	// Transport reads req.Trailer again once the body reports EOF, so the
+	// goroutine below can fill in the real values right before it closes w.
+	req.Trailer = http.Header{"Digest": nil, "Content-MD5": nil}
+
+	go func() {
+		defer file.Close()
+		defer w.Close()
+
+		part, err := mpw.CreateFormFile("file", meta.Filename)
+		if err != nil {
+			logger.Error("Failed to create body", "path", path, "error", err)
+			return
+		}
+
+		tee := io.MultiWriter(part, sha, md)
+		size, err := io.Copy(tee, file)
+		if err != nil {
+			logger.Error("Failed to copy file", "path", path, "error", err)
+			return
+		}
+		logger.Info("Uploaded bytes", "path", path, "bytes", size)
+
+		if err = mpw.Close(); err != nil {
+			logger.Error("Failed to close request", "path", path, "error", err)
+			return
+		}
+
+		req.Trailer.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sha.Sum(nil)))
+		req.Trailer.Set("Content-MD5", base64.StdEncoding.EncodeToString(md.Sum(nil)))
+	}()
+
+	// Post to Server, goroutine above will pipe file contents to the request
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return UploadResult{}, &UploadStatusError{StatusCode: resp.StatusCode, Err: fmt.Errorf("Failed Upload. Status Code: %v. Could not parse body: %v", resp.StatusCode, err)}
+		}
+		return UploadResult{}, &UploadStatusError{StatusCode: resp.StatusCode, Err: fmt.Errorf("Failed Upload. Status Code: %v, Body: %v", resp.StatusCode, string(body))}
+	}
+
+	return UploadResult{SHA256: hex.EncodeToString(sha.Sum(nil))}, nil
+}
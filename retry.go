@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadStatusError wraps an upload failure with the HTTP status code the
+// destination returned, so the retry policy can tell a definitively
+// rejected file (4xx) from a transient one (5xx) without string-matching
+// error text.
+type UploadStatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *UploadStatusError) Error() string { return e.Err.Error() }
+func (e *UploadStatusError) Unwrap() error { return e.Err }
+
+// nonRetryableStatusCodes are 4xx responses that mean the file itself is
+// the problem (bad request, unauthorized, not found, too large, wrong
+// type) - retrying won't help, so these go straight to failedDir.
+var nonRetryableStatusCodes = map[int]bool{
+	400: true,
+	401: true,
+	403: true,
+	404: true,
+	413: true,
+	415: true,
+}
+
+// PermanentError marks an upload failure that backends without an HTTP
+// status code (S3, SFTP) have determined won't be fixed by retrying - a
+// permissions or configuration problem on the destination - so it goes
+// straight to failedDir the same way a non-retryable UploadStatusError does.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+func isRetryable(err error) bool {
+	var statusErr *UploadStatusError
+	if errors.As(err, &statusErr) {
+		return !nonRetryableStatusCodes[statusErr.StatusCode]
+	}
+
+	var permErr *PermanentError
+	if errors.As(err, &permErr) {
+		return false
+	}
+
+	return true
+}
+
+// retryConfig controls how many times and how aggressively a failed upload
+// is retried before the file is moved to failedDir.
+type retryConfig struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// processFileWithRetry retries p.processFile with exponential backoff and
+// jitter, persisting the attempt count in a sidecar next to the source file
+// so a restart mid-retry doesn't start the attempt count over.
+func (p *program) processFileWithRetry(ctx context.Context, path string) error {
+	attempt := loadAttempt(path)
+
+	for {
+		result, err := p.processFile(ctx, path)
+		if err == nil {
+			clearAttempt(path)
+			return p.moveToCompleted(ctx, path, result)
+		}
+
+		if !isRetryable(err) {
+			clearAttempt(path)
+			return p.moveToFailed(ctx, path, "non_retryable", err)
+		}
+
+		attempt++
+		if attempt >= p.retry.maxAttempts {
+			clearAttempt(path)
+			return p.moveToFailed(ctx, path, "retries_exhausted", fmt.Errorf("exhausted %v attempts: %v", attempt, err))
+		}
+
+		if saveErr := saveAttempt(path, attempt); saveErr != nil {
+			loggerFor(ctx).Warn("Failed to persist attempt count", "path", path, "error", saveErr)
+		}
+
+		retriesTotal.Inc()
+		delay := backoffWithJitter(attempt, p.retry.baseDelay, p.retry.maxDelay)
+		loggerFor(ctx).Info("Retrying upload", "path", path, "attempt", attempt+1, "maxAttempts", p.retry.maxAttempts, "delay", delay, "error", err)
+
+		if waitErr := waitOrCancel(ctx, delay); waitErr != nil {
+			return fmt.Errorf("retry backoff for %v interrupted: %v", path, waitErr)
+		}
+	}
+}
+
+// waitOrCancel sleeps for d, returning early with ctx's error if ctx is
+// canceled first - e.g. Stop() canceling p.ctx - so a worker mid-backoff
+// doesn't block shutdown for the rest of the retry schedule.
+func waitOrCancel(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sidecar suffixes the upload pipeline writes next to a source file
+// (.attempt) or next to the moved file in completedDir/failedDir (.sha256,
+// .reason).
+// scanner.go excludes all of these from the watch/reconcile scan so they're
+// never mistaken for upload candidates.
+const (
+	attemptSidecarSuffix = ".attempt"
+	sha256SidecarSuffix  = ".sha256"
+	reasonSidecarSuffix  = ".reason"
+)
+
+func (p *program) moveToCompleted(ctx context.Context, path string, result UploadResult) error {
+	newPath := filepath.Join(p.completedDir, filepath.Base(path))
+	if err := os.Rename(path, newPath); err != nil {
+		return fmt.Errorf("Failed to move completed file: %v", err)
+	}
+
+	if result.SHA256 != "" {
+		sidecar := newPath + sha256SidecarSuffix
+		if err := ioutil.WriteFile(sidecar, []byte(result.SHA256+"  "+filepath.Base(newPath)+"\n"), 0644); err != nil {
+			loggerFor(ctx).Warn("Failed to write sha256 sidecar", "path", sidecar, "error", err)
+		}
+	}
+
+	filesUploadedTotal.Inc()
+	p.health.record(true)
+	loggerFor(ctx).Info("Uploaded file", "path", path, "sha256", result.SHA256)
+	return nil
+}
+
+func (p *program) moveToFailed(ctx context.Context, path, reason string, uploadErr error) error {
+	failedPath := filepath.Join(p.failedDir, filepath.Base(path))
+	if err := os.Rename(path, failedPath); err != nil {
+		loggerFor(ctx).Error("Failed to move failed file", "path", path, "error", err)
+	} else if reasonErr := ioutil.WriteFile(failedPath+reasonSidecarSuffix, []byte(reason+": "+uploadErr.Error()+"\n"), 0644); reasonErr != nil {
+		loggerFor(ctx).Warn("Failed to write reason sidecar", "path", failedPath, "error", reasonErr)
+	}
+
+	filesFailedTotal.WithLabelValues(reason).Inc()
+	p.health.record(false)
+	return fmt.Errorf("Failed to upload %v: %v", path, uploadErr)
+}
+
+func attemptSidecarPath(path string) string {
+	return path + attemptSidecarSuffix
+}
+
+func loadAttempt(path string) int {
+	data, err := ioutil.ReadFile(attemptSidecarPath(path))
+	if err != nil {
+		return 0
+	}
+
+	attempt, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+func saveAttempt(path string, attempt int) error {
+	return ioutil.WriteFile(attemptSidecarPath(path), []byte(strconv.Itoa(attempt)), 0644)
+}
+
+func clearAttempt(path string) {
+	os.Remove(attemptSidecarPath(path))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"plain error", errors.New("connection reset"), true},
+		{"5xx status", &UploadStatusError{StatusCode: 503, Err: errors.New("unavailable")}, true},
+		{"unmapped 4xx status", &UploadStatusError{StatusCode: 409, Err: errors.New("conflict")}, true},
+		{"bad request", &UploadStatusError{StatusCode: 400, Err: errors.New("bad request")}, false},
+		{"unauthorized", &UploadStatusError{StatusCode: 401, Err: errors.New("unauthorized")}, false},
+		{"forbidden", &UploadStatusError{StatusCode: 403, Err: errors.New("forbidden")}, false},
+		{"not found", &UploadStatusError{StatusCode: 404, Err: errors.New("not found")}, false},
+		{"payload too large", &UploadStatusError{StatusCode: 413, Err: errors.New("too large")}, false},
+		{"unsupported media type", &UploadStatusError{StatusCode: 415, Err: errors.New("unsupported")}, false},
+		{"wrapped non-retryable", fmtWrap(&UploadStatusError{StatusCode: 404, Err: errors.New("not found")}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// fmtWrap wraps err the way errors returned deeper in the call stack
+// typically reach isRetryable, to confirm errors.As still unwraps it.
+func fmtWrap(err error) error {
+	return &wrappedError{err}
+}
+
+type wrappedError struct{ err error }
+
+func (w *wrappedError) Error() string { return "wrapped: " + w.err.Error() }
+func (w *wrappedError) Unwrap() error { return w.err }
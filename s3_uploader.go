@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithy "github.com/aws/smithy-go"
+)
+
+// permanentS3ErrorCodes are S3 API error codes that mean the destination
+// itself will never accept this upload - bad credentials, wrong bucket,
+// access denied - so retrying maxAttempts times before giving up just
+// wastes the whole backoff schedule on every attempt.
+var permanentS3ErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AllAccessDisabled":     true,
+	"InvalidAccessKeyId":    true,
+	"InvalidBucketName":     true,
+	"NoSuchBucket":          true,
+	"SignatureDoesNotMatch": true,
+}
+
+// s3Config is the `s3:` block in conf.yaml. accessKeyId/secretAccessKey are
+// optional; when empty the AWS SDK's default credential chain (env vars,
+// shared config, instance role) is used instead.
+type s3Config struct {
+	region          string
+	bucket          string
+	prefix          string
+	endpoint        string
+	accessKeyID     string
+	secretAccessKey string
+}
+
+// s3Uploader uploads files to S3 (or an S3-compatible endpoint), using the
+// SDK's multipart manager so large files aren't held entirely in memory.
+type s3Uploader struct {
+	bucket   string
+	prefix   string
+	uploader *manager.Uploader
+}
+
+func newS3Uploader(cfg s3Config) (*s3Uploader, error) {
+	ctx := context.Background()
+
+	opts := []func(*config.LoadOptions) error{config.WithRegion(cfg.region)}
+	if cfg.accessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.accessKeyID, cfg.secretAccessKey, "")))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(cfg.endpoint)
+		}
+	})
+
+	return &s3Uploader{
+		bucket:   cfg.bucket,
+		prefix:   cfg.prefix,
+		uploader: manager.NewUploader(client),
+	}, nil
+}
+
+func (u *s3Uploader) Upload(ctx context.Context, filePath string, meta UploadMeta) (UploadResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+
+	sha := sha256.New()
+	key := path.Join(u.prefix, meta.Filename)
+	if _, err := u.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+		Body:   io.TeeReader(file, sha),
+	}); err != nil {
+		wrapped := fmt.Errorf("S3 upload failed for %v: %v", filePath, err)
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && permanentS3ErrorCodes[apiErr.ErrorCode()] {
+			return UploadResult{}, &PermanentError{Err: wrapped}
+		}
+		return UploadResult{}, wrapped
+	}
+	return UploadResult{SHA256: hex.EncodeToString(sha.Sum(nil))}, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// sidecarSuffixes are files the uploader itself writes next to (or in) a
+// watched directory - retry/resume state or readiness probes - and must
+// never be picked up by the scanner as upload candidates.
+var sidecarSuffixes = []string{
+	attemptSidecarSuffix,
+	tusSidecarSuffix,
+	sha256SidecarSuffix,
+	reasonSidecarSuffix,
+	writableProbeName,
+}
+
+func isSidecarFile(name string) bool {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchAndScan replaces the old ticker-driven Readdir loop with an fsnotify
+// watcher on sourceDir. A file is only emitted once `quietPeriod` has
+// elapsed since its last write, so we never grab a file that some other
+// process is still writing to. A slower reconciliation sweep runs alongside
+// it to pick up files that existed before startup or that the kernel
+// dropped events for.
+func (p *program) watchAndScan(cfg scanConfig) <-chan string {
+	// Buffered so a burst of quiet files can be handed off without blocking
+	// this goroutine; emitQuietFiles also falls back to a non-blocking send
+	// once the buffer is full, so the watcher loop never stalls waiting on
+	// a busy worker pool.
+	fileChannel := make(chan string, p.workers)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Panicf("Couldn't create file watcher: %v", err)
+	}
+	if err := watcher.Add(p.sourceDir); err != nil {
+		log.Panicf("Couldn't watch source dir %v: %v", p.sourceDir, err)
+	}
+
+	go func() {
+		defer close(fileChannel)
+		defer watcher.Close()
+
+		pending := map[string]time.Time{}
+
+		if err := p.reconcile(pending); err != nil {
+			slog.Error("Failed to read dir", "dir", p.sourceDir, "error", err)
+		}
+
+		quietTicker := time.NewTicker(quietCheckInterval(cfg.quietPeriod))
+		defer quietTicker.Stop()
+
+		reconcileTicker := time.NewTicker(cfg.scanInterval)
+		defer reconcileTicker.Stop()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) != 0 && !isSidecarFile(event.Name) {
+					pending[event.Name] = time.Now()
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Watcher error", "error", err)
+
+			case <-quietTicker.C:
+				emitQuietFiles(pending, cfg.quietPeriod, fileChannel)
+
+			case <-reconcileTicker.C:
+				if err := p.reconcile(pending); err != nil {
+					slog.Error("Failed to read dir", "dir", p.sourceDir, "error", err)
+				}
+
+			case <-p.shutdown:
+				return
+			}
+		}
+	}()
+
+	return fileChannel
+}
+
+// reconcile adds any file in sourceDir that isn't already pending, using its
+// on-disk mod time as the "last write" so the quiet period still applies.
+// This is the fallback for files present before the watcher started or for
+// events the OS coalesced or dropped.
+func (p *program) reconcile(pending map[string]time.Time) error {
+	dir, err := os.Open(p.sourceDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || isSidecarFile(fi.Name()) {
+			continue
+		}
+
+		name := filepath.Join(p.sourceDir, fi.Name())
+		if _, tracked := pending[name]; !tracked {
+			pending[name] = fi.ModTime()
+		}
+	}
+	return nil
+}
+
+// emitQuietFiles sends every pending file that has been quiet for at least
+// quietPeriod and removes it from the pending set. The send is non-blocking:
+// if the channel is full because the worker pool is saturated, the file is
+// left in pending and retried on the next quiet check rather than stalling
+// this goroutine (and with it watcher.Events/watcher.Errors/the
+// reconciliation ticker, which all share this same select loop).
+func emitQuietFiles(pending map[string]time.Time, quietPeriod time.Duration, channel chan<- string) {
+	now := time.Now()
+	for name, lastWrite := range pending {
+		if now.Sub(lastWrite) < quietPeriod {
+			continue
+		}
+
+		select {
+		case channel <- name:
+			delete(pending, name)
+			queueDepth.Inc()
+		default:
+		}
+	}
+}
+
+// quietCheckInterval polls for quiet files more often than the quiet period
+// itself so files aren't held back longer than necessary, with a sensible
+// floor so a tiny quietPeriodMs doesn't spin.
+func quietCheckInterval(quietPeriod time.Duration) time.Duration {
+	interval := quietPeriod / 2
+	if interval < 50*time.Millisecond {
+		interval = 50 * time.Millisecond
+	}
+	return interval
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpConfig is the `sftp:` block in conf.yaml. Auth is by private key when
+// privateKeyPath is set, otherwise by password. knownHostsPath is required
+// so the server's host key is actually verified rather than trusted blindly.
+type sftpConfig struct {
+	host           string
+	port           int
+	user           string
+	password       string
+	privateKeyPath string
+	knownHostsPath string
+	remoteDir      string
+}
+
+// sftpUploader uploads files over SFTP, dialing a fresh SSH connection per
+// file - this is a low-throughput drop directory, not a hot path, so the
+// simplicity is worth the extra handshake.
+type sftpUploader struct {
+	cfg sftpConfig
+}
+
+func newSFTPUploader(cfg sftpConfig) *sftpUploader {
+	return &sftpUploader{cfg: cfg}
+}
+
+func (u *sftpUploader) Upload(ctx context.Context, filePath string, meta UploadMeta) (UploadResult, error) {
+	client, closeFn, err := u.dial()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer closeFn()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+
+	remotePath := path.Join(u.cfg.remoteDir, meta.Filename)
+	remoteFile, err := client.Create(remotePath)
+	if err != nil {
+		return UploadResult{}, permanentIfNotRetryable(fmt.Errorf("failed to create remote file %v: %v", remotePath, err), err)
+	}
+	defer remoteFile.Close()
+
+	sha := sha256.New()
+	if _, err := io.Copy(remoteFile, io.TeeReader(file, sha)); err != nil {
+		return UploadResult{}, permanentIfNotRetryable(fmt.Errorf("SFTP upload failed for %v: %v", filePath, err), err)
+	}
+	return UploadResult{SHA256: hex.EncodeToString(sha.Sum(nil))}, nil
+}
+
+// permanentIfNotRetryable wraps wrapped in a PermanentError when cause is a
+// permission or missing-directory failure on the remote end - pkg/sftp
+// surfaces SFTP status codes through the standard os.IsPermission/
+// os.IsNotExist checks - since retrying won't make the remote path
+// accessible.
+func permanentIfNotRetryable(wrapped, cause error) error {
+	if os.IsPermission(cause) || os.IsNotExist(cause) {
+		return &PermanentError{Err: wrapped}
+	}
+	return wrapped
+}
+
+func (u *sftpUploader) dial() (*sftp.Client, func(), error) {
+	hostKeyCallback, err := u.hostKeyCallback()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, err := u.authMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sshCfg := &ssh.ClientConfig{
+		User:            u.cfg.user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := net.JoinHostPort(u.cfg.host, strconv.Itoa(u.cfg.port))
+	conn, err := ssh.Dial("tcp", addr, sshCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial SFTP host %v: %v", addr, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create SFTP client: %v", err)
+	}
+
+	return client, func() {
+		client.Close()
+		conn.Close()
+	}, nil
+}
+
+func (u *sftpUploader) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if u.cfg.knownHostsPath == "" {
+		return nil, fmt.Errorf("sftp.knownHostsPath must be set to verify the server's host key")
+	}
+	return knownhosts.New(u.cfg.knownHostsPath)
+}
+
+func (u *sftpUploader) authMethod() (ssh.AuthMethod, error) {
+	if u.cfg.privateKeyPath != "" {
+		key, err := ioutil.ReadFile(u.cfg.privateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key %v: %v", u.cfg.privateKeyPath, err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %v: %v", u.cfg.privateKeyPath, err)
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+
+	return ssh.Password(u.cfg.password), nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const tusResumableVersion = "1.0.0"
+
+// tusState is persisted to a `.tus` sidecar next to the source file so that
+// a service restart or network drop resumes the upload instead of starting
+// over from byte zero.
+type tusState struct {
+	UploadURL string `json:"uploadUrl"`
+	Offset    int64  `json:"offset"`
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+	ModTime   int64  `json:"modTime"`
+}
+
+// tusUploader speaks the tus resumable upload protocol: POST to create an
+// upload, HEAD to confirm the server's offset, PATCH to append chunks.
+//
+// It reuses the program-wide retryConfig for its own chunk PATCH/HEAD
+// retries rather than keeping a second, independent retry schedule. That
+// still means a failed chunk can be attempted up to retry.maxAttempts times
+// here before the error propagates to processFileWithRetry's outer loop,
+// which may itself attempt the whole file up to retry.maxAttempts times - so
+// worst case is retry.maxAttempts^2 HTTP attempts before a chunk is given up
+// on. That's the intentional ceiling: one config knob bounds both layers.
+type tusUploader struct {
+	endpoint  string
+	chunkSize int64
+	retry     retryConfig
+
+	client *http.Client
+}
+
+func newTusUploader(endpoint string, chunkSize int64, retry retryConfig) *tusUploader {
+	return &tusUploader{
+		endpoint:  endpoint,
+		chunkSize: chunkSize,
+		retry:     retry,
+		client:    &http.Client{},
+	}
+}
+
+// tusSidecarSuffix is the sidecar scanner.go excludes from the watched
+// directory so a checkpoint write never gets re-ingested as a new upload.
+const tusSidecarSuffix = ".tus"
+
+func sidecarPath(path string) string {
+	return path + tusSidecarSuffix
+}
+
+func (u *tusUploader) Upload(ctx context.Context, path string, meta UploadMeta) (UploadResult, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	checksum, err := u.checksumFor(path, fi)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("failed to checksum %v: %v", path, err)
+	}
+
+	state, err := u.resumeOrCreate(ctx, path, meta, fi, checksum)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer file.Close()
+
+	for state.Offset < meta.Size {
+		if _, err := file.Seek(state.Offset, io.SeekStart); err != nil {
+			return UploadResult{}, err
+		}
+
+		n := u.chunkSize
+		if remaining := meta.Size - state.Offset; remaining < n {
+			n = remaining
+		}
+
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			return UploadResult{}, fmt.Errorf("failed to read chunk for %v at offset %v: %v", path, state.Offset, err)
+		}
+
+		newOffset, err := u.patchChunkWithRetry(ctx, state.UploadURL, state.Offset, chunk)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		state.Offset = newOffset
+
+		if err := u.saveState(path, state); err != nil {
+			return UploadResult{}, fmt.Errorf("failed to persist tus state for %v: %v", path, err)
+		}
+	}
+
+	os.Remove(sidecarPath(path))
+	return UploadResult{SHA256: checksum}, nil
+}
+
+// checksumFor returns the checksum to resume/create the upload with. If the
+// sidecar already holds one for a file of the same size and mtime, it's
+// reused instead of re-hashing the whole file - sha256File reads the file
+// sequentially from disk, so rehashing it on every processFileWithRetry
+// attempt would cost a full extra read on top of the chunked work already
+// done.
+func (u *tusUploader) checksumFor(path string, fi os.FileInfo) (string, error) {
+	if state, err := u.loadState(path); err == nil && state.Size == fi.Size() && state.ModTime == fi.ModTime().UnixNano() {
+		return state.Checksum, nil
+	}
+	return sha256File(path)
+}
+
+// resumeOrCreate loads the sidecar for path, if any, and confirms the
+// server agrees on the offset. If there is no sidecar, or the server has
+// forgotten the upload, a new one is created.
+func (u *tusUploader) resumeOrCreate(ctx context.Context, path string, meta UploadMeta, fi os.FileInfo, checksum string) (*tusState, error) {
+	if state, err := u.loadState(path); err == nil && state.Checksum == checksum {
+		offset, headErr := u.headOffsetWithRetry(ctx, state.UploadURL)
+		if headErr == nil {
+			state.Offset = offset
+			return state, nil
+		}
+	}
+
+	uploadURL, err := u.createUpload(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &tusState{UploadURL: uploadURL, Offset: 0, Checksum: checksum, Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+	if err := u.saveState(path, state); err != nil {
+		return nil, fmt.Errorf("failed to persist tus state for %v: %v", path, err)
+	}
+	return state, nil
+}
+
+func (u *tusUploader) createUpload(ctx context.Context, meta UploadMeta) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", tusResumableVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(meta.Size, 10))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(meta.Filename)))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("tus create failed. Status Code: %v, Body: %v", resp.StatusCode, string(body))
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("tus create response missing Location header")
+	}
+	return location, nil
+}
+
+// headOffsetWithRetry retries the offset check with the same backoff as
+// chunk PATCHes: a single transient error here must not make resumeOrCreate
+// give up on an existing (possibly mostly-uploaded) upload and start over
+// from byte zero.
+func (u *tusUploader) headOffsetWithRetry(ctx context.Context, uploadURL string) (int64, error) {
+	var lastErr error
+	for attempt := 0; attempt < u.retry.maxAttempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := waitOrCancel(ctx, backoffWithJitter(attempt, u.retry.baseDelay, u.retry.maxDelay)); waitErr != nil {
+				return 0, waitErr
+			}
+		}
+
+		offset, err := u.headOffset(ctx, uploadURL)
+		if err == nil {
+			return offset, nil
+		}
+		lastErr = err
+	}
+	return 0, fmt.Errorf("tus head exhausted %v attempts: %v", u.retry.maxAttempts, lastErr)
+}
+
+func (u *tusUploader) headOffset(ctx context.Context, uploadURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", tusResumableVersion)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("tus head failed. Status Code: %v", resp.StatusCode)
+	}
+
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+func (u *tusUploader) patchChunkWithRetry(ctx context.Context, uploadURL string, offset int64, chunk []byte) (int64, error) {
+	var lastErr error
+	for attempt := 0; attempt < u.retry.maxAttempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := waitOrCancel(ctx, backoffWithJitter(attempt, u.retry.baseDelay, u.retry.maxDelay)); waitErr != nil {
+				return 0, waitErr
+			}
+		}
+
+		newOffset, err := u.patchChunk(ctx, uploadURL, offset, chunk)
+		if err == nil {
+			return newOffset, nil
+		}
+		lastErr = err
+	}
+	return 0, fmt.Errorf("tus patch exhausted %v attempts: %v", u.retry.maxAttempts, lastErr)
+}
+
+func (u *tusUploader) patchChunk(ctx context.Context, uploadURL string, offset int64, chunk []byte) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, uploadURL, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", tusResumableVersion)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.ContentLength = int64(len(chunk))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return 0, fmt.Errorf("tus patch failed. Status Code: %v, Body: %v", resp.StatusCode, string(body))
+	}
+
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+func (u *tusUploader) loadState(path string) (*tusState, error) {
+	data, err := ioutil.ReadFile(sidecarPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var state tusState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (u *tusUploader) saveState(path string, state *tusState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sidecarPath(path), data, 0644)
+}
+
+// backoffWithJitter returns an exponential backoff delay for the given
+// attempt number, capped at max and jittered by +/-25% to avoid thundering
+// herds when many files fail around the same time.
+func backoffWithJitter(attempt int, base, max time.Duration) time.Duration {
+	delay := base * time.Duration(1<<uint(attempt-1))
+	if delay > max {
+		delay = max
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2+1)) - delay/4
+	delay += jitter
+	if delay < 0 {
+		delay = base
+	}
+	return delay
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffWithJitterBounds(t *testing.T) {
+	base := 500 * time.Millisecond
+	max := 30 * time.Second
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		for i := 0; i < 20; i++ {
+			delay := backoffWithJitter(attempt, base, max)
+			if delay < 0 {
+				t.Fatalf("attempt %v: backoffWithJitter returned negative delay %v", attempt, delay)
+			}
+			if delay > max+max/4 {
+				t.Fatalf("attempt %v: backoffWithJitter returned %v, want <= %v", attempt, delay, max+max/4)
+			}
+		}
+	}
+}
+
+func TestBackoffWithJitterCapsAtMax(t *testing.T) {
+	base := 500 * time.Millisecond
+	max := 2 * time.Second
+
+	// A large attempt number would overflow the exponential term well past
+	// max; confirm it's still capped (plus jitter) rather than exploding.
+	for i := 0; i < 20; i++ {
+		delay := backoffWithJitter(20, base, max)
+		if delay > max+max/4 {
+			t.Fatalf("backoffWithJitter(20, ...) = %v, want <= %v", delay, max+max/4)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "context"
+
+// UploadMeta carries the information an Uploader needs about a file that
+// isn't already implied by its path on disk.
+type UploadMeta struct {
+	Filename string
+	Size     int64
+}
+
+// UploadResult carries information computed while the file was uploaded
+// that callers need afterwards, such as the checksum written into the
+// completedDir .sha256 sidecar.
+type UploadResult struct {
+	SHA256 string
+}
+
+// Uploader sends the contents of a file to some destination. Implementations
+// are swapped via the `backend`/`http.mode` config and the scanner/retry
+// plumbing around processFile never needs to know which one is in use.
+type Uploader interface {
+	Upload(ctx context.Context, path string, meta UploadMeta) (UploadResult, error)
+}